@@ -2,6 +2,7 @@ package compute
 
 import (
 	"fmt"
+	"regexp"
 
 	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2019-07-01/compute"
 	"github.com/hashicorp/terraform/helper/schema"
@@ -139,12 +140,52 @@ func VirtualMachineScaleSetOSDiskSchema() *schema.Schema {
 					Default:  false,
 					// TODO: should this be ForceNew?
 				},
+
+				// changing the Disk Encryption Set assigned to an existing OS Disk isn't supported by this API
+				// version, so this has to force a new resource
+				"disk_encryption_set_id": {
+					Type:         schema.TypeString,
+					Optional:     true,
+					ForceNew:     true,
+					ValidateFunc: azure.ValidateResourceID,
+				},
+
+				// `security_profile` (confidential VM disk encryption) isn't supported by the vendored Azure
+				// Compute API (2019-07-01) yet - this is rejected in `ExpandVirtualMachineScaleSetOSDisk` below,
+				// but the schema is left in place so it can be wired up once the SDK is updated.
+				"security_profile": {
+					Type:     schema.TypeList,
+					Optional: true,
+					MaxItems: 1,
+					Elem: &schema.Resource{
+						Schema: map[string]*schema.Schema{
+							"security_encryption_type": {
+								Type:     schema.TypeString,
+								Required: true,
+								ForceNew: true,
+								ValidateFunc: validation.StringInSlice([]string{
+									"VMGuestStateOnly",
+									"DiskWithVMGuestState",
+								}, false),
+							},
+
+							// the Disk Encryption Set used for the confidential VM's encrypted VM Guest State can
+							// only be specified when `security_encryption_type` is `DiskWithVMGuestState`
+							"disk_encryption_set_id": {
+								Type:         schema.TypeString,
+								Optional:     true,
+								ForceNew:     true,
+								ValidateFunc: azure.ValidateResourceID,
+							},
+						},
+					},
+				},
 			},
 		},
 	}
 }
 
-func ExpandVirtualMachineScaleSetOSDisk(input []interface{}, osType compute.OperatingSystemTypes) *compute.VirtualMachineScaleSetOSDisk {
+func ExpandVirtualMachineScaleSetOSDisk(input []interface{}, osType compute.OperatingSystemTypes) (*compute.VirtualMachineScaleSetOSDisk, error) {
 	raw := input[0].(map[string]interface{})
 	disk := compute.VirtualMachineScaleSetOSDisk{
 		Caching: compute.CachingTypes(raw["caching"].(string)),
@@ -169,7 +210,20 @@ func ExpandVirtualMachineScaleSetOSDisk(input []interface{}, osType compute.Oper
 		}
 	}
 
-	return &disk
+	if desID := raw["disk_encryption_set_id"].(string); desID != "" {
+		disk.ManagedDisk.DiskEncryptionSet = &compute.DiskEncryptionSetParameters{
+			ID: utils.String(desID),
+		}
+	}
+
+	// confidential-VM disk security profiles (`VMDiskSecurityProfile`/`SecurityEncryptionType`) aren't exposed by
+	// the vendored Azure Compute API (2019-07-01) yet, so this is validated locally and rejected until this
+	// package is built against a newer API version
+	if securityProfileRaw := raw["security_profile"].([]interface{}); len(securityProfileRaw) > 0 {
+		return nil, fmt.Errorf("`security_profile` is not currently supported by the Azure Compute API vendored in this provider - Confidential VM disk encryption requires a newer API version than is vendored here")
+	}
+
+	return &disk, nil
 }
 
 func FlattenVirtualMachineScaleSetOSDisk(input *compute.VirtualMachineScaleSetOSDisk) []interface{} {
@@ -189,11 +243,18 @@ func FlattenVirtualMachineScaleSetOSDisk(input *compute.VirtualMachineScaleSetOS
 		diskSizeGb = int(*input.DiskSizeGB)
 	}
 
-	var storageAccountType string
+	var storageAccountType, diskEncryptionSetID string
 	if input.ManagedDisk != nil {
 		storageAccountType = string(input.ManagedDisk.StorageAccountType)
+
+		if input.ManagedDisk.DiskEncryptionSet != nil && input.ManagedDisk.DiskEncryptionSet.ID != nil {
+			diskEncryptionSetID = *input.ManagedDisk.DiskEncryptionSet.ID
+		}
 	}
 
+	// `security_profile` is never populated on read - see the note in `ExpandVirtualMachineScaleSetOSDisk`
+	securityProfile := make([]interface{}, 0)
+
 	writeAcceleratorEnabled := false
 	if input.WriteAcceleratorEnabled != nil {
 		writeAcceleratorEnabled = *input.WriteAcceleratorEnabled
@@ -205,15 +266,188 @@ func FlattenVirtualMachineScaleSetOSDisk(input *compute.VirtualMachineScaleSetOS
 			"diff_data_settings":        diffDataSettings,
 			"storage_account_type":      storageAccountType,
 			"write_accelerator_enabled": writeAcceleratorEnabled,
+			"disk_encryption_set_id":    diskEncryptionSetID,
+			"security_profile":          securityProfile,
 		},
 	}
 }
 
+func VirtualMachineScaleSetDataDiskSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Optional: true,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"caching": {
+					Type:     schema.TypeString,
+					Required: true,
+					ValidateFunc: validation.StringInSlice([]string{
+						string(compute.CachingTypesNone),
+						string(compute.CachingTypesReadOnly),
+						string(compute.CachingTypesReadWrite),
+					}, false),
+				},
+
+				"create_option": {
+					Type:     schema.TypeString,
+					Optional: true,
+					Default:  string(compute.DiskCreateOptionTypesEmpty),
+					ValidateFunc: validation.StringInSlice([]string{
+						string(compute.DiskCreateOptionTypesEmpty),
+						string(compute.DiskCreateOptionTypesFromImage),
+					}, false),
+				},
+
+				"disk_size_gb": {
+					Type:         schema.TypeInt,
+					Required:     true,
+					ValidateFunc: validation.IntBetween(1, 32767),
+				},
+
+				"lun": {
+					Type:         schema.TypeInt,
+					Required:     true,
+					ValidateFunc: validation.IntBetween(0, 2000),
+				},
+
+				"storage_account_type": {
+					Type:     schema.TypeString,
+					Required: true,
+					ValidateFunc: validation.StringInSlice([]string{
+						string(compute.StorageAccountTypesPremiumLRS),
+						string(compute.StorageAccountTypesStandardLRS),
+						string(compute.StorageAccountTypesStandardSSDLRS),
+						string(compute.StorageAccountTypesUltraSSDLRS),
+					}, false),
+				},
+
+				// only applicable to `UltraSSD_LRS` disks, Azure will assign a default based on `disk_size_gb` when unset
+				"disk_iops_read_write": {
+					Type:         schema.TypeInt,
+					Optional:     true,
+					Computed:     true,
+					ValidateFunc: validation.IntAtLeast(1),
+				},
+
+				// only applicable to `UltraSSD_LRS` disks, Azure will assign a default based on `disk_size_gb` when unset
+				"disk_mbps_read_write": {
+					Type:         schema.TypeInt,
+					Optional:     true,
+					Computed:     true,
+					ValidateFunc: validation.IntAtLeast(1),
+				},
+			},
+		},
+	}
+}
+
+// ExpandVirtualMachineScaleSetDataDisk expands the `data_disk` blocks into the Data Disks which'll be provisioned
+// as part of this Virtual Machine Scale Set. `ultraSSDEnabled` is the value of the scale set's
+// `additional_capabilities.0.ultra_ssd_enabled` field, since Azure requires this to be enabled before any
+// `UltraSSD_LRS` data disk can be attached.
+//
+// note: Azure rejects the Create/Update API call with a clear error when `UltraSSD_LRS` is requested in a
+// region/zone which doesn't support Ultra Disks, so there's no need to duplicate that validation here - and
+// Azure expands the list of supported regions/zones faster than the provider could track it anyway.
+func ExpandVirtualMachineScaleSetDataDisk(input []interface{}, ultraSSDEnabled bool) (*[]compute.VirtualMachineScaleSetDataDisk, error) {
+	disks := make([]compute.VirtualMachineScaleSetDataDisk, 0)
+
+	for _, v := range input {
+		raw := v.(map[string]interface{})
+
+		storageAccountType := compute.StorageAccountTypes(raw["storage_account_type"].(string))
+		iops := raw["disk_iops_read_write"].(int)
+		mbps := raw["disk_mbps_read_write"].(int)
+
+		if storageAccountType == compute.StorageAccountTypesUltraSSDLRS {
+			if !ultraSSDEnabled {
+				return nil, fmt.Errorf("an `additional_capabilities` block with `ultra_ssd_enabled` set to `true` must be specified when a `data_disk`'s `storage_account_type` is set to `UltraSSD_LRS`")
+			}
+		} else if iops > 0 || mbps > 0 {
+			return nil, fmt.Errorf("`disk_iops_read_write` and `disk_mbps_read_write` can only be configured when `storage_account_type` is set to `UltraSSD_LRS`")
+		}
+
+		disk := compute.VirtualMachineScaleSetDataDisk{
+			Caching:      compute.CachingTypes(raw["caching"].(string)),
+			CreateOption: compute.DiskCreateOptionTypes(raw["create_option"].(string)),
+			DiskSizeGB:   utils.Int32(int32(raw["disk_size_gb"].(int))),
+			Lun:          utils.Int32(int32(raw["lun"].(int))),
+			ManagedDisk: &compute.VirtualMachineScaleSetManagedDiskParameters{
+				StorageAccountType: storageAccountType,
+			},
+		}
+
+		if iops > 0 {
+			disk.DiskIOPSReadWrite = utils.Int64(int64(iops))
+		}
+
+		if mbps > 0 {
+			disk.DiskMBpsReadWrite = utils.Int64(int64(mbps))
+		}
+
+		disks = append(disks, disk)
+	}
+
+	return &disks, nil
+}
+
+func FlattenVirtualMachineScaleSetDataDisk(input *[]compute.VirtualMachineScaleSetDataDisk) []interface{} {
+	if input == nil {
+		return []interface{}{}
+	}
+
+	output := make([]interface{}, 0)
+
+	for _, v := range *input {
+		storageAccountType := ""
+		if v.ManagedDisk != nil {
+			storageAccountType = string(v.ManagedDisk.StorageAccountType)
+		}
+
+		diskSizeGb := 0
+		if v.DiskSizeGB != nil {
+			diskSizeGb = int(*v.DiskSizeGB)
+		}
+
+		lun := 0
+		if v.Lun != nil {
+			lun = int(*v.Lun)
+		}
+
+		iops := 0
+		if v.DiskIOPSReadWrite != nil {
+			iops = int(*v.DiskIOPSReadWrite)
+		}
+
+		mbps := 0
+		if v.DiskMBpsReadWrite != nil {
+			mbps = int(*v.DiskMBpsReadWrite)
+		}
+
+		output = append(output, map[string]interface{}{
+			"caching":              string(v.Caching),
+			"create_option":        string(v.CreateOption),
+			"disk_size_gb":         diskSizeGb,
+			"lun":                  lun,
+			"storage_account_type": storageAccountType,
+			"disk_iops_read_write": iops,
+			"disk_mbps_read_write": mbps,
+		})
+	}
+
+	return output
+}
+
 func VirtualMachineScaleSetSourceImageReferenceSchema() *schema.Schema {
 	// whilst originally I was hoping we could use the 'id' from `azurerm_platform_image' unfortunately Azure doesn't
 	// like this as a value for the 'id' field:
 	// Id /...../Versions/16.04.201909091 is not a valid resource reference."
 	// as such the image is split into two fields (source_image_id and source_image_reference) to provide better validation
+	//
+	// `shared_gallery_image_id` and `community_gallery_image_id` are accepted by the schema as a third and fourth
+	// image source, but the vendored Azure Compute API (2019-07-01) has no field for either - so
+	// `ExpandVirtualMachineScaleSetSourceImageReference` returns an error when either is set, and
+	// `FlattenVirtualMachineScaleSetSourceImageReference` always returns them empty
 	return &schema.Schema{
 		Type:     schema.TypeList,
 		Optional: true,
@@ -222,41 +456,76 @@ func VirtualMachineScaleSetSourceImageReferenceSchema() *schema.Schema {
 			Schema: map[string]*schema.Schema{
 				"publisher": {
 					Type:          schema.TypeString,
-					Required:      true,
-					ConflictsWith: []string{"source_image_id"},
+					Optional:      true,
+					ConflictsWith: []string{"source_image_id", "source_image_reference.0.shared_gallery_image_id", "source_image_reference.0.community_gallery_image_id"},
 				},
 				"offer": {
 					Type:          schema.TypeString,
-					Required:      true,
-					ConflictsWith: []string{"source_image_id"},
+					Optional:      true,
+					ConflictsWith: []string{"source_image_id", "source_image_reference.0.shared_gallery_image_id", "source_image_reference.0.community_gallery_image_id"},
 				},
 				"sku": {
 					Type:          schema.TypeString,
-					Required:      true,
-					ConflictsWith: []string{"source_image_id"},
+					Optional:      true,
+					ConflictsWith: []string{"source_image_id", "source_image_reference.0.shared_gallery_image_id", "source_image_reference.0.community_gallery_image_id"},
 				},
 				"version": {
 					Type:          schema.TypeString,
-					Required:      true,
-					ConflictsWith: []string{"source_image_id"},
+					Optional:      true,
+					ConflictsWith: []string{"source_image_id", "source_image_reference.0.shared_gallery_image_id", "source_image_reference.0.community_gallery_image_id"},
+				},
+
+				"shared_gallery_image_id": {
+					Type:          schema.TypeString,
+					Optional:      true,
+					ConflictsWith: []string{"source_image_id", "source_image_reference.0.publisher", "source_image_reference.0.offer", "source_image_reference.0.sku", "source_image_reference.0.version", "source_image_reference.0.community_gallery_image_id"},
+				},
+
+				"community_gallery_image_id": {
+					Type:          schema.TypeString,
+					Optional:      true,
+					ConflictsWith: []string{"source_image_id", "source_image_reference.0.publisher", "source_image_reference.0.offer", "source_image_reference.0.sku", "source_image_reference.0.version", "source_image_reference.0.shared_gallery_image_id"},
 				},
 			},
 		},
 	}
 }
 
-func ExpandVirtualMachineScaleSetSourceImageReference(input []interface{}) *compute.ImageReference {
+func ExpandVirtualMachineScaleSetSourceImageReference(input []interface{}) (*compute.ImageReference, error) {
 	if len(input) == 0 {
-		return nil
+		return nil, nil
 	}
 
 	raw := input[0].(map[string]interface{})
-	return &compute.ImageReference{
-		Publisher: utils.String(raw["publisher"].(string)),
-		Offer:     utils.String(raw["offer"].(string)),
-		Sku:       utils.String(raw["sku"].(string)),
-		Version:   utils.String(raw["version"].(string)),
+
+	// neither of these are supported by the vendored Azure Compute API (2019-07-01) yet
+	if sharedGalleryImageID := raw["shared_gallery_image_id"].(string); sharedGalleryImageID != "" {
+		return nil, fmt.Errorf("`shared_gallery_image_id` is not currently supported by the Azure Compute API vendored in this provider - use `source_image_id` with the Shared Image Gallery image version's resource ID instead")
+	}
+	if communityGalleryImageID := raw["community_gallery_image_id"].(string); communityGalleryImageID != "" {
+		return nil, fmt.Errorf("`community_gallery_image_id` is not currently supported by the Azure Compute API vendored in this provider")
 	}
+
+	publisher := raw["publisher"].(string)
+	offer := raw["offer"].(string)
+	sku := raw["sku"].(string)
+	version := raw["version"].(string)
+
+	platformImageSet := publisher != "" || offer != "" || sku != "" || version != ""
+	if !platformImageSet {
+		return nil, nil
+	}
+
+	if publisher == "" || offer == "" || sku == "" || version == "" {
+		return nil, fmt.Errorf("`publisher`, `offer`, `sku` and `version` must all be specified when referencing a platform image")
+	}
+
+	return &compute.ImageReference{
+		Publisher: utils.String(publisher),
+		Offer:     utils.String(offer),
+		Sku:       utils.String(sku),
+		Version:   utils.String(version),
+	}, nil
 }
 
 func FlattenVirtualMachineScaleSetSourceImageReference(input *compute.ImageReference) []interface{} {
@@ -280,12 +549,16 @@ func FlattenVirtualMachineScaleSetSourceImageReference(input *compute.ImageRefer
 		version = *input.Version
 	}
 
+	// `shared_gallery_image_id`/`community_gallery_image_id` are never populated on read - see the note in
+	// `ExpandVirtualMachineScaleSetSourceImageReference`
 	return []interface{}{
 		map[string]interface{}{
-			"publisher": publisher,
-			"offer":     offer,
-			"sku":       sku,
-			"version":   version,
+			"publisher":                  publisher,
+			"offer":                      offer,
+			"sku":                        sku,
+			"version":                    version,
+			"shared_gallery_image_id":    "",
+			"community_gallery_image_id": "",
 		},
 	}
 }
@@ -348,6 +621,19 @@ func VirtualMachineScaleSetUpgradePolicySchema() *schema.Schema {
 								Type:     schema.TypeString,
 								Required: true,
 							},
+
+							// reorders the upgrade batch so instances failing their health probe are upgraded
+							// before healthy ones - not currently supported by the vendored Azure Compute API
+							// (2019-07-01), so this is rejected in `ExpandVirtualMachineScaleSetUpgradePolicy` below
+							"prioritize_unhealthy_instances": {
+								Type:     schema.TypeBool,
+								Optional: true,
+							},
+
+							// `max_surge_instance_percent` and `node_soak_duration` were requested alongside
+							// `prioritize_unhealthy_instances`, but neither is exposed on `RollingUpgradePolicy` in
+							// the vendored Azure Compute API (2019-07-01) either, so they've been left out of this
+							// schema entirely rather than added as fields that can never be honoured
 						},
 					},
 				},
@@ -383,6 +669,12 @@ func ExpandVirtualMachineScaleSetUpgradePolicy(input []interface{}) (*compute.Up
 		}
 
 		rollingRaw := rollingPoliciesRaw[0].(map[string]interface{})
+
+		// `prioritize_unhealthy_instances` isn't supported by the vendored Azure Compute API (2019-07-01) yet
+		if rollingRaw["prioritize_unhealthy_instances"].(bool) {
+			return nil, fmt.Errorf("`prioritize_unhealthy_instances` is not currently supported by the Azure Compute API vendored in this provider")
+		}
+
 		policy.RollingUpgradePolicy = &compute.RollingUpgradePolicy{
 			MaxBatchInstancePercent:             utils.Int32(int32(rollingRaw["max_batch_instance_percent"].(int))),
 			MaxUnhealthyInstancePercent:         utils.Int32(int32(rollingRaw["max_unhealthy_instance_percent"].(int))),
@@ -446,11 +738,14 @@ func FlattenVirtualMachineScaleSetUpgradePolicy(input *compute.UpgradePolicy) []
 			pauseTimeBetweenBatches = *policy.PauseTimeBetweenBatches
 		}
 
+		// `prioritize_unhealthy_instances` is never populated on read - see the note in
+		// `ExpandVirtualMachineScaleSetUpgradePolicy`
 		rollingOutput = append(rollingOutput, map[string]interface{}{
 			"max_batch_instance_percent":              maxBatchInstancePercent,
 			"max_unhealthy_instance_percent":          maxUnhealthyInstancePercent,
 			"max_unhealthy_upgraded_instance_percent": maxUnhealthyUpgradedInstancePercent,
 			"pause_time_between_batches":              pauseTimeBetweenBatches,
+			"prioritize_unhealthy_instances":          false,
 		})
 	}
 
@@ -462,3 +757,205 @@ func FlattenVirtualMachineScaleSetUpgradePolicy(input *compute.UpgradePolicy) []
 		},
 	}
 }
+
+// automaticRepairsGracePeriodRegex matches an ISO-8601 duration between 30 minutes and 90 minutes written in whole
+// minutes (`PT30M` to `PT90M`), which is the range Azure's Automatic Repairs feature accepts for the grace period
+// between an instance first reporting unhealthy and a repair action being triggered. Durations written with an
+// hours component (such as `PT1H`) are not matched.
+var automaticRepairsGracePeriodRegex = regexp.MustCompile(`^PT([3-8][0-9]|90)M$`)
+
+func VirtualMachineScaleSetAutomaticRepairPolicySchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Optional: true,
+		MaxItems: 1,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"enabled": {
+					Type:     schema.TypeBool,
+					Required: true,
+				},
+
+				"grace_period": {
+					Type:         schema.TypeString,
+					Optional:     true,
+					Default:      "PT30M",
+					ValidateFunc: validation.StringMatch(automaticRepairsGracePeriodRegex, "`grace_period` must be an ISO-8601 duration between `PT30M` and `PT90M`"),
+				},
+
+				// NOTE: `RepairAction` isn't exposed by the vendored Azure Compute API (2019-07-01) yet - Azure
+				// only supports replacing the unhealthy instance until a newer API version is available, so this
+				// only accepts the one value Azure actually honours today.
+				"repair_action": {
+					Type:     schema.TypeString,
+					Optional: true,
+					Default:  "Replace",
+					ValidateFunc: validation.StringInSlice([]string{
+						"Replace",
+					}, false),
+				},
+			},
+		},
+	}
+}
+
+// ExpandVirtualMachineScaleSetAutomaticRepairPolicy expands the `automatic_instance_repair` block into the
+// `AutomaticRepairsPolicy` Azure expects. `hasHealthExtensionOrProbe` indicates whether the scale set has a health
+// extension or an Application Health Probe configured elsewhere on the resource - Azure rejects enabling automatic
+// repairs without one of these, since that's the only way Azure can determine an instance is unhealthy.
+func ExpandVirtualMachineScaleSetAutomaticRepairPolicy(input []interface{}, hasHealthExtensionOrProbe bool) (*compute.AutomaticRepairsPolicy, error) {
+	if len(input) == 0 || input[0] == nil {
+		return nil, nil
+	}
+
+	raw := input[0].(map[string]interface{})
+	enabled := raw["enabled"].(bool)
+
+	if enabled && !hasHealthExtensionOrProbe {
+		return nil, fmt.Errorf("`automatic_instance_repair` can only be enabled when a Health Extension or an Application Health Probe is configured on this Virtual Machine Scale Set")
+	}
+
+	if repairAction := raw["repair_action"].(string); repairAction != "" && repairAction != "Replace" {
+		return nil, fmt.Errorf("`repair_action` is not currently supported by the Azure Compute API vendored in this provider - unhealthy instances can only be replaced")
+	}
+
+	return &compute.AutomaticRepairsPolicy{
+		Enabled:     utils.Bool(enabled),
+		GracePeriod: utils.String(raw["grace_period"].(string)),
+	}, nil
+}
+
+func FlattenVirtualMachineScaleSetAutomaticRepairPolicy(input *compute.AutomaticRepairsPolicy) []interface{} {
+	if input == nil {
+		return []interface{}{}
+	}
+
+	enabled := false
+	if input.Enabled != nil {
+		enabled = *input.Enabled
+	}
+
+	gracePeriod := ""
+	if input.GracePeriod != nil {
+		gracePeriod = *input.GracePeriod
+	}
+
+	return []interface{}{
+		map[string]interface{}{
+			"enabled":       enabled,
+			"grace_period":  gracePeriod,
+			"repair_action": "Replace",
+		},
+	}
+}
+
+func VirtualMachineScaleSetSpotPrioritySchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Optional: true,
+		MaxItems: 1,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"priority": {
+					Type:     schema.TypeString,
+					Optional: true,
+					Default:  string(compute.VirtualMachinePriorityTypesRegular),
+					ValidateFunc: validation.StringInSlice([]string{
+						string(compute.VirtualMachinePriorityTypesRegular),
+						string(compute.VirtualMachinePriorityTypesSpot),
+						string(compute.VirtualMachinePriorityTypesLow),
+					}, false),
+				},
+
+				"eviction_policy": {
+					Type:     schema.TypeString,
+					Optional: true,
+					ValidateFunc: validation.StringInSlice([]string{
+						string(compute.VirtualMachineEvictionPolicyTypesDeallocate),
+						string(compute.VirtualMachineEvictionPolicyTypesDelete),
+					}, false),
+				},
+
+				// -1 means "pay up to the on-demand price" and is the only legal value when the Eviction Policy
+				// isn't being used to cap spend
+				"max_bid_price": {
+					Type:     schema.TypeFloat,
+					Optional: true,
+					Default:  -1,
+				},
+			},
+		},
+	}
+}
+
+// VirtualMachineScaleSetSpotPriorityExpandResult bundles the Virtual Machine Profile fields `priority` populates,
+// since they're spread across `VirtualMachineProfile.Priority`/`EvictionPolicy`/`BillingProfile` rather than a
+// single nested struct - plus whether the caller must force `overprovision` off, which Azure requires for Spot
+// scale sets but which lives on the parent resource rather than here.
+type VirtualMachineScaleSetSpotPriorityExpandResult struct {
+	Priority                  compute.VirtualMachinePriorityTypes
+	EvictionPolicy            compute.VirtualMachineEvictionPolicyTypes
+	BillingProfile            *compute.BillingProfile
+	ForceDisableOverprovision bool
+}
+
+func ExpandVirtualMachineScaleSetSpotPriority(input []interface{}) (*VirtualMachineScaleSetSpotPriorityExpandResult, error) {
+	result := &VirtualMachineScaleSetSpotPriorityExpandResult{
+		Priority: compute.VirtualMachinePriorityTypesRegular,
+	}
+
+	if len(input) == 0 || input[0] == nil {
+		return result, nil
+	}
+
+	raw := input[0].(map[string]interface{})
+	priority := compute.VirtualMachinePriorityTypes(raw["priority"].(string))
+	evictionPolicy := raw["eviction_policy"].(string)
+	maxBidPrice := raw["max_bid_price"].(float64)
+
+	result.Priority = priority
+
+	if priority == compute.VirtualMachinePriorityTypesRegular {
+		if evictionPolicy != "" {
+			return nil, fmt.Errorf("`eviction_policy` can only be configured when `priority` is set to `Spot` or `Low`")
+		}
+
+		if maxBidPrice != -1 {
+			return nil, fmt.Errorf("`max_bid_price` can only be configured when `priority` is set to `Spot` or `Low`")
+		}
+
+		return result, nil
+	}
+
+	if evictionPolicy == "" {
+		return nil, fmt.Errorf("`eviction_policy` must be configured when `priority` is set to `%s`", priority)
+	}
+
+	result.EvictionPolicy = compute.VirtualMachineEvictionPolicyTypes(evictionPolicy)
+	result.BillingProfile = &compute.BillingProfile{
+		MaxPrice: utils.Float64(maxBidPrice),
+	}
+
+	// Azure rejects Spot scale sets which have `overprovision` enabled, since overprovisioned instances could be
+	// evicted immediately - the calling resource must fold this into the `overprovision` value it sends
+	if priority == compute.VirtualMachinePriorityTypesSpot {
+		result.ForceDisableOverprovision = true
+	}
+
+	return result, nil
+}
+
+func FlattenVirtualMachineScaleSetSpotPriority(priority compute.VirtualMachinePriorityTypes, evictionPolicy compute.VirtualMachineEvictionPolicyTypes, billingProfile *compute.BillingProfile) []interface{} {
+	maxBidPrice := float64(-1)
+	if billingProfile != nil && billingProfile.MaxPrice != nil {
+		maxBidPrice = *billingProfile.MaxPrice
+	}
+
+	return []interface{}{
+		map[string]interface{}{
+			"priority":        string(priority),
+			"eviction_policy": string(evictionPolicy),
+			"max_bid_price":   maxBidPrice,
+		},
+	}
+}
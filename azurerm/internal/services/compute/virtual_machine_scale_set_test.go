@@ -0,0 +1,282 @@
+package compute
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2019-07-01/compute"
+)
+
+func TestExpandVirtualMachineScaleSetDataDisk_ultraSSDRequiresCapability(t *testing.T) {
+	input := []interface{}{
+		map[string]interface{}{
+			"caching":              "None",
+			"create_option":        "Empty",
+			"disk_size_gb":         1024,
+			"lun":                  0,
+			"storage_account_type": "UltraSSD_LRS",
+			"disk_iops_read_write": 0,
+			"disk_mbps_read_write": 0,
+		},
+	}
+
+	if _, err := ExpandVirtualMachineScaleSetDataDisk(input, false); err == nil {
+		t.Fatalf("expected an error when `ultra_ssd_enabled` is false but a `UltraSSD_LRS` data disk is configured")
+	}
+}
+
+func TestExpandVirtualMachineScaleSetDataDisk_nonUltraSSDDisallowsIOPS(t *testing.T) {
+	input := []interface{}{
+		map[string]interface{}{
+			"caching":              "None",
+			"create_option":        "Empty",
+			"disk_size_gb":         128,
+			"lun":                  0,
+			"storage_account_type": "Premium_LRS",
+			"disk_iops_read_write": 500,
+			"disk_mbps_read_write": 0,
+		},
+	}
+
+	if _, err := ExpandVirtualMachineScaleSetDataDisk(input, false); err == nil {
+		t.Fatalf("expected an error when `disk_iops_read_write` is set on a non-`UltraSSD_LRS` disk")
+	}
+}
+
+func baseOSDiskRaw() map[string]interface{} {
+	return map[string]interface{}{
+		"caching":                   "ReadWrite",
+		"storage_account_type":      "Premium_LRS",
+		"diff_disk_settings":        []interface{}{},
+		"disk_size_gb":              0,
+		"write_accelerator_enabled": false,
+		"disk_encryption_set_id":    "",
+		"security_profile":          []interface{}{},
+	}
+}
+
+func TestExpandVirtualMachineScaleSetOSDisk_securityProfileNotSupported(t *testing.T) {
+	raw := baseOSDiskRaw()
+	raw["security_profile"] = []interface{}{
+		map[string]interface{}{
+			"security_encryption_type": "DiskWithVMGuestState",
+			"disk_encryption_set_id":   "",
+		},
+	}
+
+	if _, err := ExpandVirtualMachineScaleSetOSDisk([]interface{}{raw}, compute.Linux); err == nil {
+		t.Fatalf("expected an error when `security_profile` is set, since it's not supported by the vendored API")
+	}
+}
+
+func TestExpandVirtualMachineScaleSetOSDisk_noSecurityProfile(t *testing.T) {
+	raw := baseOSDiskRaw()
+
+	if _, err := ExpandVirtualMachineScaleSetOSDisk([]interface{}{raw}, compute.Linux); err != nil {
+		t.Fatalf("expected no error but got: %+v", err)
+	}
+}
+
+func TestExpandVirtualMachineScaleSetUpgradePolicy_prioritizeUnhealthyInstancesNotSupported(t *testing.T) {
+	raw := map[string]interface{}{
+		"mode":                        "Rolling",
+		"automatic_os_upgrade_policy": []interface{}{},
+		"rolling_upgrade_policy": []interface{}{
+			map[string]interface{}{
+				"max_batch_instance_percent":              20,
+				"max_unhealthy_instance_percent":          20,
+				"max_unhealthy_upgraded_instance_percent": 20,
+				"pause_time_between_batches":              "PT0S",
+				"prioritize_unhealthy_instances":          true,
+			},
+		},
+	}
+
+	if _, err := ExpandVirtualMachineScaleSetUpgradePolicy([]interface{}{raw}); err == nil {
+		t.Fatalf("expected an error when `prioritize_unhealthy_instances` is set, since it's not supported by the vendored API")
+	}
+}
+
+func baseSourceImageReferenceRaw() map[string]interface{} {
+	return map[string]interface{}{
+		"publisher":                  "",
+		"offer":                      "",
+		"sku":                        "",
+		"version":                    "",
+		"shared_gallery_image_id":    "",
+		"community_gallery_image_id": "",
+	}
+}
+
+func TestExpandVirtualMachineScaleSetSourceImageReference_sharedGalleryImageIDNotSupported(t *testing.T) {
+	raw := baseSourceImageReferenceRaw()
+	raw["shared_gallery_image_id"] = "/SharedGalleries/gallery/Images/image/Versions/1.0.0"
+
+	if _, err := ExpandVirtualMachineScaleSetSourceImageReference([]interface{}{raw}); err == nil {
+		t.Fatalf("expected an error when `shared_gallery_image_id` is set, since it's not supported by the vendored API")
+	}
+}
+
+func TestExpandVirtualMachineScaleSetSourceImageReference_communityGalleryImageIDNotSupported(t *testing.T) {
+	raw := baseSourceImageReferenceRaw()
+	raw["community_gallery_image_id"] = "/CommunityGalleries/gallery/Images/image/Versions/1.0.0"
+
+	if _, err := ExpandVirtualMachineScaleSetSourceImageReference([]interface{}{raw}); err == nil {
+		t.Fatalf("expected an error when `community_gallery_image_id` is set, since it's not supported by the vendored API")
+	}
+}
+
+func TestExpandVirtualMachineScaleSetSourceImageReference_rejectsMultipleSources(t *testing.T) {
+	raw := baseSourceImageReferenceRaw()
+	raw["shared_gallery_image_id"] = "/SharedGalleries/gallery/Images/image/Versions/1.0.0"
+	raw["publisher"] = "Canonical"
+	raw["offer"] = "UbuntuServer"
+	raw["sku"] = "18.04-LTS"
+	raw["version"] = "latest"
+
+	if _, err := ExpandVirtualMachineScaleSetSourceImageReference([]interface{}{raw}); err == nil {
+		t.Fatalf("expected an error when both `shared_gallery_image_id` and a platform image are specified")
+	}
+}
+
+func TestExpandVirtualMachineScaleSetSourceImageReference_platformImageRequiresAllFields(t *testing.T) {
+	raw := baseSourceImageReferenceRaw()
+	raw["publisher"] = "Canonical"
+
+	if _, err := ExpandVirtualMachineScaleSetSourceImageReference([]interface{}{raw}); err == nil {
+		t.Fatalf("expected an error when only `publisher` is set without `offer`/`sku`/`version`")
+	}
+}
+
+func TestExpandVirtualMachineScaleSetAutomaticRepairPolicy_requiresHealthExtensionOrProbe(t *testing.T) {
+	raw := []interface{}{
+		map[string]interface{}{
+			"enabled":       true,
+			"grace_period":  "PT30M",
+			"repair_action": "Replace",
+		},
+	}
+
+	if _, err := ExpandVirtualMachineScaleSetAutomaticRepairPolicy(raw, false); err == nil {
+		t.Fatalf("expected an error when `enabled` is `true` but no Health Extension or Application Health Probe is configured")
+	}
+}
+
+func TestExpandVirtualMachineScaleSetAutomaticRepairPolicy_replaceIsApplied(t *testing.T) {
+	raw := []interface{}{
+		map[string]interface{}{
+			"enabled":       true,
+			"grace_period":  "PT30M",
+			"repair_action": "Replace",
+		},
+	}
+
+	policy, err := ExpandVirtualMachineScaleSetAutomaticRepairPolicy(raw, true)
+	if err != nil {
+		t.Fatalf("expected no error but got: %+v", err)
+	}
+
+	if policy.Enabled == nil || !*policy.Enabled {
+		t.Fatalf("expected `Enabled` to be `true`")
+	}
+
+	if policy.GracePeriod == nil || *policy.GracePeriod != "PT30M" {
+		t.Fatalf("expected `GracePeriod` to be `PT30M`, got %+v", policy.GracePeriod)
+	}
+}
+
+func TestExpandVirtualMachineScaleSetAutomaticRepairPolicy_repairActionNotSupported(t *testing.T) {
+	raw := []interface{}{
+		map[string]interface{}{
+			"enabled":       true,
+			"grace_period":  "PT30M",
+			"repair_action": "Restart",
+		},
+	}
+
+	if _, err := ExpandVirtualMachineScaleSetAutomaticRepairPolicy(raw, true); err == nil {
+		t.Fatalf("expected an error when `repair_action` is set to anything other than `Replace`")
+	}
+}
+
+func baseSpotPriorityRaw() map[string]interface{} {
+	return map[string]interface{}{
+		"priority":        "Regular",
+		"eviction_policy": "",
+		"max_bid_price":   float64(-1),
+	}
+}
+
+func TestExpandVirtualMachineScaleSetSpotPriority_regularDisallowsEvictionPolicy(t *testing.T) {
+	raw := baseSpotPriorityRaw()
+	raw["eviction_policy"] = "Delete"
+
+	if _, err := ExpandVirtualMachineScaleSetSpotPriority([]interface{}{raw}); err == nil {
+		t.Fatalf("expected an error when `eviction_policy` is set but `priority` is `Regular`")
+	}
+}
+
+func TestExpandVirtualMachineScaleSetSpotPriority_regularDisallowsMaxBidPrice(t *testing.T) {
+	raw := baseSpotPriorityRaw()
+	raw["max_bid_price"] = float64(0.5)
+
+	if _, err := ExpandVirtualMachineScaleSetSpotPriority([]interface{}{raw}); err == nil {
+		t.Fatalf("expected an error when `max_bid_price` is set but `priority` is `Regular`")
+	}
+}
+
+func TestExpandVirtualMachineScaleSetSpotPriority_spotRequiresEvictionPolicy(t *testing.T) {
+	raw := baseSpotPriorityRaw()
+	raw["priority"] = "Spot"
+
+	if _, err := ExpandVirtualMachineScaleSetSpotPriority([]interface{}{raw}); err == nil {
+		t.Fatalf("expected an error when `priority` is `Spot` but `eviction_policy` isn't set")
+	}
+}
+
+func TestExpandVirtualMachineScaleSetSpotPriority_spotForcesDisableOverprovision(t *testing.T) {
+	raw := baseSpotPriorityRaw()
+	raw["priority"] = "Spot"
+	raw["eviction_policy"] = "Delete"
+	raw["max_bid_price"] = float64(0.5)
+
+	result, err := ExpandVirtualMachineScaleSetSpotPriority([]interface{}{raw})
+	if err != nil {
+		t.Fatalf("expected no error but got: %+v", err)
+	}
+
+	if !result.ForceDisableOverprovision {
+		t.Fatalf("expected `ForceDisableOverprovision` to be `true` for `Spot` priority")
+	}
+
+	if result.BillingProfile == nil || result.BillingProfile.MaxPrice == nil || *result.BillingProfile.MaxPrice != 0.5 {
+		t.Fatalf("expected `BillingProfile.MaxPrice` to be `0.5`, got %+v", result.BillingProfile)
+	}
+
+	flattened := FlattenVirtualMachineScaleSetSpotPriority(result.Priority, result.EvictionPolicy, result.BillingProfile)
+	if got := flattened[0].(map[string]interface{})["max_bid_price"]; got != 0.5 {
+		t.Fatalf("expected `max_bid_price` to round-trip as `0.5`, got %v", got)
+	}
+}
+
+func TestExpandVirtualMachineScaleSetSpotPriority_lowDoesNotForceDisableOverprovision(t *testing.T) {
+	raw := baseSpotPriorityRaw()
+	raw["priority"] = "Low"
+	raw["eviction_policy"] = "Deallocate"
+
+	result, err := ExpandVirtualMachineScaleSetSpotPriority([]interface{}{raw})
+	if err != nil {
+		t.Fatalf("expected no error but got: %+v", err)
+	}
+
+	if result.ForceDisableOverprovision {
+		t.Fatalf("expected `ForceDisableOverprovision` to be `false` for `Low` priority")
+	}
+}
+
+func TestFlattenVirtualMachineScaleSetSpotPriority_noBillingProfile(t *testing.T) {
+	flattened := FlattenVirtualMachineScaleSetSpotPriority(compute.VirtualMachinePriorityTypesRegular, "", nil)
+
+	if got := flattened[0].(map[string]interface{})["max_bid_price"]; got != float64(-1) {
+		t.Fatalf("expected `max_bid_price` to default to `-1` when no `BillingProfile` is set, got %v", got)
+	}
+}